@@ -0,0 +1,46 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewAutocertListener is a one-line HTTPS server setup: it wires an
+// autocert.Manager for domains into NewListenerTLS and binds :443, so
+// certificates are obtained on demand from Let's Encrypt via the
+// TLS-ALPN-01 challenge baked into autocert.Manager.TLSConfig, with
+// read/write deadlines enforced the same way as any other Listener.
+//
+// cacheDir, if non-empty, is used as an autocert.DirCache so renewed
+// certificates survive a restart.
+func NewAutocertListener(domains []string, cacheDir string, readTimeout, writeTimeout time.Duration) (net.Listener, error) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+	}
+	if cacheDir != "" {
+		m.Cache = autocert.DirCache(cacheDir)
+	}
+
+	tlsOpts := TLSOptions{
+		Config: m.TLSConfig(),
+		HTTP2:  true,
+	}
+	return NewListenerTLS("tcp", ":443", tlsOpts, readTimeout, writeTimeout)
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// withinBound fails the test if elapsed exceeds bound, which should be
+// comfortably larger than the short timeout under test but much smaller
+// than the long one it must not fall back to.
+func withinBound(t *testing.T, elapsed, bound time.Duration) {
+	t.Helper()
+	if elapsed > bound {
+		t.Fatalf("took %v, want under %v", elapsed, bound)
+	}
+}
+
+// TestConnReadAppliesDeadlineOnFreshConn ensures a brand-new Conn enforces
+// ReadHeaderTimeout on its very first Read, before SetIdle has ever been
+// called, instead of blocking with no deadline at all.
+func TestConnReadAppliesDeadlineOnFreshConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{
+		Conn:              server,
+		ReadTimeout:       2 * time.Second,
+		ReadHeaderTimeout: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := c.Read(make([]byte, 16))
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Read succeeded, want a deadline timeout error")
+	}
+	withinBound(t, elapsed, 500*time.Millisecond)
+}
+
+// TestConnReadHeaderTimeoutSpansMultipleReads ensures ReadHeaderTimeout
+// bounds the whole header-reading phase, not just the single Read that
+// happens to run right after a state change: a client that sends a few
+// header bytes and then stalls must still be cut off by
+// ReadHeaderTimeout, not allowed to ride out the much larger ReadTimeout.
+func TestConnReadHeaderTimeoutSpansMultipleReads(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{
+		Conn:              server,
+		ReadTimeout:       2 * time.Second,
+		ReadHeaderTimeout: 50 * time.Millisecond,
+	}
+
+	go client.Write([]byte("G"))
+
+	buf := make([]byte, 16)
+	if _, err := c.Read(buf); err != nil {
+		t.Fatalf("first Read: %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.Read(buf)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("second Read succeeded, want a deadline timeout error")
+	}
+	withinBound(t, elapsed, 500*time.Millisecond)
+}
+
+// TestConnSetIdleAppliesIdleTimeout ensures SetIdle(true) bounds the wait
+// for the next request by IdleTimeout.
+func TestConnSetIdleAppliesIdleTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{
+		Conn:        server,
+		ReadTimeout: 2 * time.Second,
+		IdleTimeout: 50 * time.Millisecond,
+	}
+
+	if err := c.SetIdle(true); err != nil {
+		t.Fatalf("SetIdle(true): %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.Read(make([]byte, 16))
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Read succeeded, want an idle timeout error")
+	}
+	withinBound(t, elapsed, 500*time.Millisecond)
+}
+
+// TestConnSetIdleFalseAppliesReadTimeout ensures SetIdle(false), used once
+// headers are in and the handler takes over, (re)arms ReadTimeout for the
+// rest of the request.
+func TestConnSetIdleFalseAppliesReadTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{
+		Conn:              server,
+		ReadTimeout:       80 * time.Millisecond,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	if err := c.SetIdle(false); err != nil {
+		t.Fatalf("SetIdle(false): %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.Read(make([]byte, 16))
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Read succeeded, want a deadline timeout error")
+	}
+	withinBound(t, elapsed, 500*time.Millisecond)
+}
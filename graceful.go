@@ -0,0 +1,109 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+)
+
+// envListenFDs is the environment variable GracefulRestart uses to tell a
+// child process how many listening sockets it inherited, following the
+// systemd/Caddy socket-activation convention.
+const envListenFDs = "LISTEN_FDS"
+
+// listenFDStart is the first inherited file descriptor number. Descriptors
+// 0, 1 and 2 are reserved for stdin, stdout and stderr.
+const listenFDStart = 3
+
+// inheritedListener returns the listening socket passed down by a parent
+// process via GracefulRestart, if any. ok is false when the process wasn't
+// started as part of a graceful restart.
+func inheritedListener() (l net.Listener, ok bool, err error) {
+	count, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || count < 1 {
+		return nil, false, nil
+	}
+
+	f := os.NewFile(uintptr(listenFDStart), "httptimeout-inherited")
+	l, err = net.FileListener(f)
+	if err != nil {
+		return nil, false, err
+	}
+	// net.FileListener dup()s the fd, so our copy can be closed independently
+	// of the net.Listener it produced.
+	f.Close()
+	return l, true, nil
+}
+
+// fileListener is implemented by the concrete listener types (*net.TCPListener,
+// *net.UnixListener) that can hand back their underlying *os.File.
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// GracefulRestart re-executes the running binary, passing the file
+// descriptor behind l to the child process so it can resume accepting
+// connections on the same socket without dropping any. The child is
+// started with LISTEN_FDS=1 set; it should create its listener with
+// WithInheritedListener to pick the socket back up. The caller is
+// responsible for shutting the current process down once in-flight
+// requests have drained.
+func GracefulRestart(l net.Listener) (*os.Process, error) {
+	fl, ok := underlyingFileListener(l)
+	if !ok {
+		return nil, errors.New("httptimeout: listener does not support graceful restart")
+	}
+
+	f, err := fl.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	env := append(os.Environ(), envListenFDs+"=1")
+	attr := &os.ProcAttr{
+		Env:   env,
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, f},
+	}
+	return os.StartProcess(execPath, os.Args, attr)
+}
+
+// underlyingFileListener unwraps our Listener to find a concrete listener
+// that can produce an *os.File for its socket. For a Listener built by
+// NewListener/NewListenerTLS it uses the pre-TLS listener captured in raw,
+// since a *tls.Listener's embedded net.Listener field never promotes the
+// concrete TCPListener/UnixListener's File() method and there'd be no way
+// to get the fd back out of it otherwise. A Listener assembled by hand
+// (raw left nil) falls back to asserting its exported Listener field
+// directly.
+func underlyingFileListener(l net.Listener) (fileListener, bool) {
+	if tl, ok := l.(*Listener); ok {
+		if tl.raw != nil {
+			l = tl.raw
+		} else {
+			l = tl.Listener
+		}
+	}
+	fl, ok := l.(fileListener)
+	return fl, ok
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestUnderlyingFileListenerPlain(t *testing.T) {
+	ln, err := NewListener("tcp", "127.0.0.1:0", 0, 0)
+	if err != nil {
+		t.Fatalf("NewListener: %v", err)
+	}
+	defer ln.Close()
+
+	if _, ok := underlyingFileListener(ln); !ok {
+		t.Fatal("expected a plain NewListener result to support graceful restart")
+	}
+}
+
+func TestUnderlyingFileListenerTLS(t *testing.T) {
+	opts := TLSOptions{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return nil, nil
+	}}
+	ln, err := NewListenerTLS("tcp", "127.0.0.1:0", opts, 0, 0)
+	if err != nil {
+		t.Fatalf("NewListenerTLS: %v", err)
+	}
+	defer ln.Close()
+
+	// Before raw was threaded through, this failed: tls.NewListener's
+	// return type embeds net.Listener as an interface field, which never
+	// promotes the concrete TCPListener's File() method.
+	if _, ok := underlyingFileListener(ln); !ok {
+		t.Fatal("expected a NewListenerTLS result to support graceful restart")
+	}
+}
+
+func TestUnderlyingFileListenerHandBuilt(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer raw.Close()
+
+	// A Listener assembled without going through NewListener/NewListenerTLS
+	// has no raw listener to fall back on; underlyingFileListener must
+	// still work off its exported Listener field directly.
+	tl := &Listener{Listener: raw}
+	if _, ok := underlyingFileListener(tl); !ok {
+		t.Fatal("expected a hand-built Listener to fall back to its Listener field")
+	}
+}
@@ -18,22 +18,143 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	schemeHTTP  = "http://"
+	schemeHTTPS = "https://"
+	schemeUnix  = "unix://"
+	schemeUnixS = "unixs://"
+)
+
+// resolveAddr strips a URL-style scheme prefix (http://, https://, unix://,
+// unixs://) from addr, similar to etcd's transport package. It returns the
+// network to use for net.Listen and the bare address, so callers can keep
+// passing either a plain "host:port" / "tcp" pair or a scheme-prefixed URL.
+func resolveAddr(network, addr string) (string, string) {
+	switch {
+	case strings.HasPrefix(addr, schemeUnix):
+		return "unix", strings.TrimPrefix(addr, schemeUnix)
+	case strings.HasPrefix(addr, schemeUnixS):
+		return "unix", strings.TrimPrefix(addr, schemeUnixS)
+	case strings.HasPrefix(addr, schemeHTTP):
+		return network, strings.TrimPrefix(addr, schemeHTTP)
+	case strings.HasPrefix(addr, schemeHTTPS):
+		return network, strings.TrimPrefix(addr, schemeHTTPS)
+	default:
+		return network, addr
+	}
+}
+
 // Conn wraps a net.Conn, and sets a deadline for every read
 // and write operation.
+//
+// When IdleTimeout or ReadHeaderTimeout is non-zero, Conn additionally
+// tracks whether it is currently idle (waiting for the next keep-alive
+// request) or actively serving one, via SetIdle. In that mode the read
+// deadline is only extended when the state changes or new bytes actually
+// arrive after an idle period, instead of on every Read call, so a single
+// idle connection doesn't erase the timeout it's supposed to enforce.
 type Conn struct {
 	net.Conn
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+
+	state int32 // atomic connState, see SetIdle
+	armed int32 // atomic bool: has a deadline been set for the current state?
+}
+
+// connState tracks where a Conn is in the idle/header/body lifecycle of a
+// keep-alive connection. It only matters when IdleTimeout or
+// ReadHeaderTimeout is set; otherwise Conn falls back to its original
+// behavior of resetting the read deadline on every call.
+//
+// connStateHeader is the zero value on purpose: a freshly accepted Conn
+// hasn't been idle yet, but its very first Read is still reading a request
+// line/headers, so it needs the same deadline treatment as a connection
+// that just came out of an idle wait.
+type connState int32
+
+const (
+	connStateHeader connState = iota
+	connStateIdle
+	connStateActive
+)
+
+// tracksIdle reports whether idle/header-aware deadline handling is
+// enabled for c. It's off by default so existing callers that never set
+// IdleTimeout or ReadHeaderTimeout see no behavior change.
+func (c *Conn) tracksIdle() bool {
+	return c.IdleTimeout > 0 || c.ReadHeaderTimeout > 0
+}
+
+// SetIdle tells the Conn whether it is currently idle, i.e. waiting for
+// the next request on a keep-alive connection, or actively serving one.
+// A server should call SetIdle(true) right before it blocks on reading the
+// next request and SetIdle(false) once it has read the request headers and
+// moves on to the body/handler. It is a no-op unless IdleTimeout or
+// ReadHeaderTimeout is set.
+func (c *Conn) SetIdle(idle bool) error {
+	if !c.tracksIdle() {
+		return nil
+	}
+	if idle {
+		atomic.StoreInt32(&c.state, int32(connStateIdle))
+		atomic.StoreInt32(&c.armed, 1)
+		if c.IdleTimeout > 0 {
+			return c.Conn.SetReadDeadline(time.Now().Add(c.IdleTimeout))
+		}
+		return c.Conn.SetReadDeadline(time.Time{})
+	}
+	atomic.StoreInt32(&c.state, int32(connStateActive))
+	atomic.StoreInt32(&c.armed, 1)
+	return c.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
 }
 
 // Read wraps the net.Conn's original Read method.
 func (c *Conn) Read(b []byte) (int, error) {
-	err := c.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
-	if err != nil {
-		return 0, err
+	if !c.tracksIdle() {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout)); err != nil {
+			return 0, err
+		}
+		return c.Conn.Read(b)
+	}
+
+	state := connState(atomic.LoadInt32(&c.state))
+	if state == connStateIdle {
+		n, err := c.Conn.Read(b)
+		if n > 0 {
+			// Bytes of a new request arrived after the idle wait: move
+			// into the header-reading phase. The deadline for it is set
+			// below, the next time through this function, so it covers
+			// this call's leftover budget instead of a fresh one.
+			atomic.StoreInt32(&c.state, int32(connStateHeader))
+			atomic.StoreInt32(&c.armed, 0)
+		}
+		return n, err
+	}
+
+	// connStateHeader (including a brand-new Conn, which starts here) or
+	// connStateActive: set the deadline for this state exactly once, the
+	// first time it's read in, and leave it alone on every later call.
+	// That way ReadHeaderTimeout/ReadTimeout bound the whole phase — all
+	// the reads needed to get the headers, or the body, across — rather
+	// than just whichever single Read happens to run right after a state
+	// change, which a client trickling bytes in slowly could ride forever.
+	if atomic.CompareAndSwapInt32(&c.armed, 0, 1) {
+		d := c.ReadTimeout
+		if state == connStateHeader && c.ReadHeaderTimeout > 0 {
+			d = c.ReadHeaderTimeout
+		}
+		if err := c.Conn.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return 0, err
+		}
 	}
 	return c.Conn.Read(b)
 }
@@ -67,25 +188,50 @@ func NewTransport(addr string, readTimeout, writeTimeout time.Duration) *http.Tr
 
 // Listener wraps a net.Listener, and gives a place to store the timeout
 // parameters. On Accept, it will wrap the net.Conn with our own Conn for us.
+//
+// IdleTimeout and ReadHeaderTimeout mirror http.Server's fields of the same
+// name from Go 1.8+ and are passed through to each accepted Conn; see Conn
+// and Conn.SetIdle for how they're enforced.
+//
+// MaxConnections and MaxConnectionsPerIP bound how many connections Accept
+// will hand out in total and per remote IP; see Accept, ActiveConns and
+// RejectedConns.
 type Listener struct {
 	net.Listener
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+
+	MaxConnections      int
+	MaxConnectionsPerIP int
+	RejectOnLimit       bool
+
+	// raw is the listener newRawListener bound, before NewListenerTLS (if
+	// used) wraps it with tls.NewListener. GracefulRestart needs it: the
+	// *tls.Listener crypto/tls hands back embeds net.Listener as an
+	// interface field, so it never promotes a concrete File() method, and
+	// there's no exported way to get the fd back out of it. Keeping the
+	// pre-TLS listener around lets underlyingFileListener reach the real
+	// socket regardless of whether l is plain or TLS.
+	raw net.Listener
+
+	limiterOnce sync.Once
+	sem         chan struct{}
+	perIP       *ipLimiter
+	active      int64
+	rejected    int64
 }
 
-// Accept wraps the Accept method of the original Listener. It waits for the next call and returns
-// a Conn which wraps the net.Conn with timeout.
-func (l *Listener) Accept() (net.Conn, error) {
-	c, err := l.Listener.Accept()
-	if err != nil {
-		return nil, err
+// newConn wraps c with l's timeout parameters, the way Accept always has.
+func (l *Listener) newConn(c net.Conn) *Conn {
+	return &Conn{
+		Conn:              c,
+		ReadTimeout:       l.ReadTimeout,
+		WriteTimeout:      l.WriteTimeout,
+		IdleTimeout:       l.IdleTimeout,
+		ReadHeaderTimeout: l.ReadHeaderTimeout,
 	}
-	tc := &Conn{
-		Conn:         c,
-		ReadTimeout:  l.ReadTimeout,
-		WriteTimeout: l.WriteTimeout,
-	}
-	return tc, nil
 }
 
 // NewListener runs net.Listen and announces on the network address addr with timeout.
@@ -93,8 +239,25 @@ func (l *Listener) Accept() (net.Conn, error) {
 // For TCP and UDP, the syntax of addr is "host:port", like "127.0.0.1:8080".
 // If host is omitted, as in ":8080", Listen listens on all available interfaces instead of just the interface with the
 // given host address.
-func NewListener(network, addr string, readTimeout, writeTimeout time.Duration) (net.Listener, error) {
-	conn, err := net.Listen(network, addr)
+//
+// addr may also carry a URL-style scheme prefix ("http://", "https://",
+// "unix://" or "unixs://"), in which case network is inferred from the
+// scheme and the prefix is stripped before binding. This makes it possible
+// to transparently switch between TCP and Unix domain sockets by changing
+// a single address string.
+//
+// opts may be used to tune the underlying socket (WithReusePort,
+// WithReuseAddr, WithFreeBind) or to pick up a listener inherited from a
+// parent process started via GracefulRestart (WithInheritedListener).
+func NewListener(network, addr string, readTimeout, writeTimeout time.Duration, opts ...ListenerOption) (net.Listener, error) {
+	network, addr = resolveAddr(network, addr)
+
+	cfg := &listenerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	conn, err := newRawListener(cfg, network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -103,25 +266,28 @@ func NewListener(network, addr string, readTimeout, writeTimeout time.Duration)
 		Listener:     conn,
 		ReadTimeout:  readTimeout,
 		WriteTimeout: writeTimeout,
+		raw:          conn,
 	}
 	return tl, nil
 }
 
-// NewListenerTLS is just a TLS enabled version of NewListener.
-func NewListenerTLS(network, addr, certFile, keyFile string, readTimeout, writeTimeout time.Duration) (net.Listener, error) {
-	config := &tls.Config{}
-	if config.NextProtos == nil {
-		config.NextProtos = []string{"http/1.1"}
-	}
-
-	var err error
-	config.Certificates = make([]tls.Certificate, 1)
-	config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+// NewListenerTLS is just a TLS enabled version of NewListener. tlsOpts
+// controls certificates, ALPN and any other *tls.Config knobs; see
+// TLSOptions.
+func NewListenerTLS(network, addr string, tlsOpts TLSOptions, readTimeout, writeTimeout time.Duration, opts ...ListenerOption) (net.Listener, error) {
+	config, err := tlsOpts.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.Listen(network, addr)
+	network, addr = resolveAddr(network, addr)
+
+	cfg := &listenerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	conn, err := newRawListener(cfg, network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +295,7 @@ func NewListenerTLS(network, addr, certFile, keyFile string, readTimeout, writeT
 		Listener:     tls.NewListener(conn, config),
 		ReadTimeout:  readTimeout,
 		WriteTimeout: writeTimeout,
+		raw:          conn,
 	}
 	return tl, nil
 }
@@ -0,0 +1,227 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// initLimiter lazily builds the semaphore and per-IP tracker described by
+// MaxConnections/MaxConnectionsPerIP. It runs once, the first time Accept
+// is called, so callers can keep setting those fields on the *Listener
+// returned by NewListener right up until they start serving.
+func (l *Listener) initLimiter() {
+	if l.MaxConnections > 0 {
+		l.sem = make(chan struct{}, l.MaxConnections)
+	}
+	if l.MaxConnectionsPerIP > 0 {
+		l.perIP = newIPLimiter(l.MaxConnectionsPerIP)
+	}
+}
+
+// Accept wraps the Accept method of the original Listener. It waits for the
+// next call and returns a Conn which wraps the net.Conn with timeout.
+//
+// If MaxConnections or MaxConnectionsPerIP is set, Accept also enforces
+// them: once a limit is reached, Accept blocks until a connection frees up,
+// or, when RejectOnLimit is true, immediately closes the new connection and
+// keeps waiting for the next one instead. RejectedConns counts connections
+// turned away this way.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.limiterOnce.Do(l.initLimiter)
+
+	for {
+		if l.sem != nil {
+			if l.RejectOnLimit {
+				select {
+				case l.sem <- struct{}{}:
+				default:
+					c, err := l.Listener.Accept()
+					if err != nil {
+						return nil, err
+					}
+					atomic.AddInt64(&l.rejected, 1)
+					c.Close()
+					continue
+				}
+			} else {
+				l.sem <- struct{}{}
+			}
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if l.sem != nil {
+				<-l.sem
+			}
+			return nil, err
+		}
+
+		var ip string
+		if l.perIP != nil {
+			ip = remoteIP(c)
+			if !l.perIP.acquire(ip) {
+				atomic.AddInt64(&l.rejected, 1)
+				c.Close()
+				if l.sem != nil {
+					<-l.sem
+				}
+				continue
+			}
+		}
+
+		atomic.AddInt64(&l.active, 1)
+		return &limitedConn{Conn: l.newConn(c), l: l, ip: ip}, nil
+	}
+}
+
+// ActiveConns reports how many connections Accept has handed out that
+// haven't been closed yet.
+func (l *Listener) ActiveConns() int64 {
+	return atomic.LoadInt64(&l.active)
+}
+
+// RejectedConns reports how many connections Accept has turned away because
+// MaxConnections or MaxConnectionsPerIP was exceeded and RejectOnLimit is
+// true.
+func (l *Listener) RejectedConns() int64 {
+	return atomic.LoadInt64(&l.rejected)
+}
+
+// remoteIP extracts the host part of c.RemoteAddr, falling back to the full
+// address if it can't be split (e.g. a Unix domain socket).
+func remoteIP(c net.Conn) string {
+	addr := c.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// limitedConn decrements the Listener's counters once, when the connection
+// is closed, releasing its slot in the semaphore and its per-IP count.
+type limitedConn struct {
+	*Conn
+	l  *Listener
+	ip string
+
+	closeOnce sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&c.l.active, -1)
+		if c.l.perIP != nil {
+			c.l.perIP.release(c.ip)
+		}
+		if c.l.sem != nil {
+			<-c.l.sem
+		}
+	})
+	return err
+}
+
+// ipLimiterCapacity bounds how many distinct remote IPs an ipLimiter keeps
+// entries for at once. It's sized generously above any realistic count of
+// concurrently active distinct remote addresses for a single process.
+const ipLimiterCapacity = 4096
+
+// ipLimiterEntry is one node of the LRU, tracking the active connection
+// count for a single remote IP.
+type ipLimiterEntry struct {
+	ip    string
+	count int
+}
+
+// ipLimiter is a small LRU of active connection counts keyed by remote IP,
+// capping how many connections a single address may hold open concurrently.
+// Entries whose count has dropped to zero are the ones evicted first when
+// the LRU is full; an IP with open connections is never evicted, so
+// correctness doesn't depend on the cache actually staying within
+// capacity — it's a bound on steady-state memory, not a hard limit.
+type ipLimiter struct {
+	mu       sync.Mutex
+	elements map[string]*list.Element // ip -> node in lru
+	lru      *list.List               // front = most recently used
+	max      int                      // max connections per IP
+	capacity int                      // max distinct IPs tracked at once
+}
+
+func newIPLimiter(max int) *ipLimiter {
+	return &ipLimiter{
+		elements: make(map[string]*list.Element),
+		lru:      list.New(),
+		max:      max,
+		capacity: ipLimiterCapacity,
+	}
+}
+
+func (p *ipLimiter) acquire(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if el, ok := p.elements[ip]; ok {
+		entry := el.Value.(*ipLimiterEntry)
+		if entry.count >= p.max {
+			return false
+		}
+		entry.count++
+		p.lru.MoveToFront(el)
+		return true
+	}
+
+	p.evictOneIdle()
+	el := p.lru.PushFront(&ipLimiterEntry{ip: ip, count: 1})
+	p.elements[ip] = el
+	return true
+}
+
+func (p *ipLimiter) release(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	el, ok := p.elements[ip]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*ipLimiterEntry)
+	if entry.count > 0 {
+		entry.count--
+	}
+	p.lru.MoveToFront(el)
+}
+
+// evictOneIdle drops the least recently used entry with a zero count, if
+// the LRU is at capacity and one exists. Entries still holding connections
+// are left alone, so the cache can grow past max under pathological load
+// rather than lose track of an active IP's count.
+func (p *ipLimiter) evictOneIdle() {
+	if p.lru.Len() < p.capacity {
+		return
+	}
+	for el := p.lru.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*ipLimiterEntry)
+		if entry.count == 0 {
+			p.lru.Remove(el)
+			delete(p.elements, entry.ip)
+			return
+		}
+	}
+}
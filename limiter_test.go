@@ -0,0 +1,80 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIPLimiterPerIPCap(t *testing.T) {
+	p := newIPLimiter(2)
+
+	if !p.acquire("10.0.0.1") || !p.acquire("10.0.0.1") {
+		t.Fatal("expected first two acquires for the same IP to succeed")
+	}
+	if p.acquire("10.0.0.1") {
+		t.Fatal("expected a third acquire for the same IP to be rejected")
+	}
+
+	p.release("10.0.0.1")
+	if !p.acquire("10.0.0.1") {
+		t.Fatal("expected an acquire after a release to succeed")
+	}
+}
+
+func TestIPLimiterEvictsIdleBeforeActive(t *testing.T) {
+	p := newIPLimiter(1)
+	p.capacity = 2
+
+	if !p.acquire("10.0.0.1") {
+		t.Fatal("acquire 10.0.0.1")
+	}
+	p.release("10.0.0.1") // now idle, count 0, still tracked
+
+	if !p.acquire("10.0.0.2") {
+		t.Fatal("acquire 10.0.0.2")
+	}
+
+	// LRU is now full (capacity 2: 10.0.0.1 idle, 10.0.0.2 active).
+	// A third distinct IP must evict the idle one, not the active one.
+	if !p.acquire("10.0.0.3") {
+		t.Fatal("acquire 10.0.0.3")
+	}
+	if len(p.elements) != 2 {
+		t.Fatalf("expected 2 tracked IPs after eviction, got %d", len(p.elements))
+	}
+	if _, ok := p.elements["10.0.0.1"]; ok {
+		t.Fatal("expected idle 10.0.0.1 to have been evicted")
+	}
+	if _, ok := p.elements["10.0.0.2"]; !ok {
+		t.Fatal("expected active 10.0.0.2 to remain tracked")
+	}
+}
+
+func TestIPLimiterGrowsPastCapacityUnderAllActiveIPs(t *testing.T) {
+	p := newIPLimiter(1)
+	p.capacity = 2
+
+	for i := 0; i < 5; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		if !p.acquire(ip) {
+			t.Fatalf("acquire %s", ip)
+		}
+	}
+	if len(p.elements) != 5 {
+		t.Fatalf("expected all 5 active IPs tracked despite capacity 2, got %d", len(p.elements))
+	}
+}
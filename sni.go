@@ -0,0 +1,303 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// errSNIListenerClosed is returned by a backend listener's Accept once its
+// SNIListener has been closed.
+var errSNIListenerClosed = errors.New("httptimeout: SNIListener closed")
+
+// errNotTLSHandshake is returned when the peeked bytes don't look like a
+// TLS ClientHello.
+var errNotTLSHandshake = errors.New("httptimeout: not a TLS ClientHello")
+
+// errNoServerName is returned when a ClientHello carries no SNI server_name
+// extension.
+var errNoServerName = errors.New("httptimeout: TLS ClientHello has no SNI server name")
+
+// SNIListener peeks the SNI hostname out of each incoming TLS ClientHello,
+// without terminating TLS itself, and dispatches the connection to one of
+// several registered backend net.Listeners based on hostname match rules.
+// This lets several TLS services (HTTPS, gRPC, a custom protocol, ...)
+// share a single port, the way tools like tlsrouter do.
+//
+// Register backends with Match or MatchFunc, then run Serve to start
+// dispatching. Connections handed to a backend are still wrapped with
+// ReadTimeout/WriteTimeout, same as a plain Listener.
+type SNIListener struct {
+	net.Listener
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	mu        sync.Mutex
+	rules     []sniRule
+	donec     chan struct{}
+	closeOnce sync.Once
+}
+
+type sniRule struct {
+	match  func(serverName string) bool
+	target *sniBackend
+}
+
+// NewSNIListener wraps l, an already-bound net.Listener, with SNI-based
+// routing.
+func NewSNIListener(l net.Listener, readTimeout, writeTimeout time.Duration) *SNIListener {
+	return &SNIListener{
+		Listener:     l,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		donec:        make(chan struct{}),
+	}
+}
+
+// Match registers a backend net.Listener that receives connections whose
+// SNI hostname is exactly one of hostnames.
+func (l *SNIListener) Match(hostnames ...string) net.Listener {
+	set := make(map[string]struct{}, len(hostnames))
+	for _, h := range hostnames {
+		set[h] = struct{}{}
+	}
+	return l.MatchFunc(func(serverName string) bool {
+		_, ok := set[serverName]
+		return ok
+	})
+}
+
+// MatchFunc registers a backend net.Listener that receives connections
+// whose SNI hostname satisfies match. Rules are tried in registration
+// order; the first match wins.
+func (l *SNIListener) MatchFunc(match func(serverName string) bool) net.Listener {
+	b := &sniBackend{connc: make(chan net.Conn), l: l}
+
+	l.mu.Lock()
+	l.rules = append(l.rules, sniRule{match: match, target: b})
+	l.mu.Unlock()
+
+	return b
+}
+
+// Serve accepts connections from the underlying Listener, peeks their SNI
+// hostname, and routes each to the first registered backend whose match
+// accepts it. A connection that isn't a TLS ClientHello, carries no SNI
+// name, or matches no backend is closed. Serve blocks until the underlying
+// Listener returns an error, typically because Close was called.
+func (l *SNIListener) Serve() error {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return err
+		}
+		go l.dispatch(c)
+	}
+}
+
+// dispatch peeks c's SNI hostname and hands it to the matching backend, if
+// any.
+func (l *SNIListener) dispatch(c net.Conn) {
+	tc := &Conn{Conn: c, ReadTimeout: l.ReadTimeout, WriteTimeout: l.WriteTimeout}
+
+	serverName, conn, err := peekClientHello(tc)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	l.mu.Lock()
+	var target *sniBackend
+	for _, r := range l.rules {
+		if r.match(serverName) {
+			target = r.target
+			break
+		}
+	}
+	l.mu.Unlock()
+
+	if target == nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case target.connc <- conn:
+	case <-l.donec:
+		conn.Close()
+	}
+}
+
+// Close stops Serve's dispatch loop, unblocks any backend listener waiting
+// in Accept, and closes the underlying Listener.
+func (l *SNIListener) Close() error {
+	l.closeOnce.Do(func() { close(l.donec) })
+	return l.Listener.Close()
+}
+
+// sniBackend is the net.Listener handed back by Match/MatchFunc; Serve
+// feeds it connections whose SNI hostname matched its rule.
+type sniBackend struct {
+	connc chan net.Conn
+	l     *SNIListener
+}
+
+func (b *sniBackend) Accept() (net.Conn, error) {
+	select {
+	case c := <-b.connc:
+		return c, nil
+	case <-b.l.donec:
+		return nil, errSNIListenerClosed
+	}
+}
+
+// Close is a no-op: closing one backend shouldn't tear down the shared
+// SNIListener or its siblings. Close the SNIListener itself instead.
+func (b *sniBackend) Close() error { return nil }
+
+func (b *sniBackend) Addr() net.Addr { return b.l.Listener.Addr() }
+
+// peekClientHello reads just enough of conn to learn the SNI server name
+// from a TLS ClientHello, without consuming those bytes from the stream:
+// the returned net.Conn replays the buffered prefix before falling through
+// to conn, so a later real TLS handshake on it sees the exact same bytes.
+func peekClientHello(conn net.Conn) (serverName string, prefixed net.Conn, err error) {
+	var buf bytes.Buffer
+	r := io.TeeReader(conn, &buf)
+
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", &prefixConn{Conn: conn, prefix: buf.Bytes()}, err
+	}
+	if header[0] != 0x16 { // not a TLS handshake record
+		return "", &prefixConn{Conn: conn, prefix: buf.Bytes()}, errNotTLSHandshake
+	}
+
+	record := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(r, record); err != nil {
+		return "", &prefixConn{Conn: conn, prefix: buf.Bytes()}, err
+	}
+
+	serverName, err = parseClientHelloServerName(record)
+	return serverName, &prefixConn{Conn: conn, prefix: buf.Bytes()}, err
+}
+
+// parseClientHelloServerName extracts the SNI host_name from the handshake
+// message inside a single TLS record. It only handles the common case of a
+// ClientHello that fits in one record, which is true for virtually all
+// real-world TLS clients.
+func parseClientHelloServerName(record []byte) (string, error) {
+	if len(record) < 4 || record[0] != 0x01 { // handshake type: client_hello
+		return "", errNotTLSHandshake
+	}
+	msgLen := int(record[1])<<16 | int(record[2])<<8 | int(record[3])
+	body := record[4:]
+	if len(body) < msgLen {
+		return "", errNotTLSHandshake
+	}
+	body = body[:msgLen]
+
+	// client_version(2) + random(32)
+	pos := 34
+	if pos+1 > len(body) {
+		return "", errNotTLSHandshake
+	}
+
+	pos += 1 + int(body[pos]) // session_id
+	if pos+2 > len(body) {
+		return "", errNotTLSHandshake
+	}
+
+	cipherSuitesLen := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2 + cipherSuitesLen
+	if pos+1 > len(body) {
+		return "", errNotTLSHandshake
+	}
+
+	pos += 1 + int(body[pos]) // compression_methods
+	if pos+2 > len(body) {
+		return "", errNoServerName
+	}
+
+	extsLen := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2
+	if pos+extsLen > len(body) {
+		return "", errNotTLSHandshake
+	}
+	exts := body[pos : pos+extsLen]
+
+	for len(exts) >= 4 {
+		extType := binary.BigEndian.Uint16(exts[0:2])
+		extLen := int(binary.BigEndian.Uint16(exts[2:4]))
+		if len(exts) < 4+extLen {
+			break
+		}
+		if extType == 0 { // server_name
+			return parseServerNameExtension(exts[4 : 4+extLen])
+		}
+		exts = exts[4+extLen:]
+	}
+	return "", errNoServerName
+}
+
+// parseServerNameExtension parses the server_name extension body down to
+// the first host_name entry.
+func parseServerNameExtension(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", errNoServerName
+	}
+	listLen := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if len(data) < listLen {
+		return "", errNoServerName
+	}
+	data = data[:listLen]
+
+	for len(data) >= 3 {
+		nameType := data[0]
+		nameLen := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+nameLen {
+			break
+		}
+		if nameType == 0 { // host_name
+			return string(data[3 : 3+nameLen]), nil
+		}
+		data = data[3+nameLen:]
+	}
+	return "", errNoServerName
+}
+
+// prefixConn replays a buffered prefix (the bytes peekClientHello consumed
+// while looking for SNI) before falling through to reads on the wrapped
+// net.Conn.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
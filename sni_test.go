@@ -0,0 +1,147 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// generateTestCert returns a throwaway self-signed certificate, just
+// enough for a tls.Server to complete a handshake in these tests.
+func generateTestCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "httptimeout test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshakeThroughPeek runs a real TLS handshake over a net.Pipe, peeking
+// the server_name off the server side with peekClientHello before handing
+// the replayed connection to tls.Server. It returns the SNI name
+// peekClientHello saw and the error (if any) from completing the server
+// handshake on the replayed conn, proving the replay didn't corrupt the
+// handshake transcript.
+func handshakeThroughPeek(t *testing.T, clientServerName string) (serverName string, peekErr, handshakeErr error) {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	cert := generateTestCert(t)
+	clientDone := make(chan error, 1)
+	go func() {
+		c := tls.Client(clientConn, &tls.Config{ServerName: clientServerName, InsecureSkipVerify: true})
+		clientDone <- c.Handshake()
+	}()
+
+	serverName, prefixed, peekErr := peekClientHello(serverConn)
+
+	s := tls.Server(prefixed, &tls.Config{Certificates: []tls.Certificate{cert}})
+	handshakeErr = s.Handshake()
+
+	if err := <-clientDone; err != nil && handshakeErr == nil {
+		handshakeErr = err
+	}
+	return serverName, peekErr, handshakeErr
+}
+
+func TestPeekClientHelloExtractsServerName(t *testing.T) {
+	serverName, peekErr, handshakeErr := handshakeThroughPeek(t, "example.com")
+	if peekErr != nil {
+		t.Fatalf("peekClientHello: %v", peekErr)
+	}
+	if serverName != "example.com" {
+		t.Fatalf("serverName = %q, want %q", serverName, "example.com")
+	}
+	if handshakeErr != nil {
+		t.Fatalf("TLS handshake on the replayed conn failed: %v", handshakeErr)
+	}
+}
+
+func TestPeekClientHelloNoServerName(t *testing.T) {
+	_, peekErr, handshakeErr := handshakeThroughPeek(t, "")
+	if peekErr != errNoServerName {
+		t.Fatalf("peekClientHello error = %v, want errNoServerName", peekErr)
+	}
+	// Even when there's no SNI to report, the bytes peeked while looking
+	// for it must still be replayed so the real handshake can proceed.
+	if handshakeErr != nil {
+		t.Fatalf("TLS handshake on the replayed conn failed: %v", handshakeErr)
+	}
+}
+
+func TestPeekClientHelloNotATLSHandshake(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go clientConn.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	_, _, err := peekClientHello(serverConn)
+	if err != errNotTLSHandshake {
+		t.Fatalf("peekClientHello error = %v, want errNotTLSHandshake", err)
+	}
+}
+
+func TestParseClientHelloServerNameTruncatedExtension(t *testing.T) {
+	// A minimal, otherwise well-formed ClientHello body (handshake header +
+	// client_version + random + empty session_id/cipher_suites/compression)
+	// whose extensions block declares a server_name extension longer than
+	// the bytes actually present.
+	body := []byte{}
+	body = append(body, make([]byte, 2+32)...) // client_version + random
+	body = append(body, 0x00)                  // session_id length 0
+	body = append(body, 0x00, 0x00)            // cipher_suites length 0
+	body = append(body, 0x00)                  // compression_methods length 0
+
+	ext := []byte{0x00, 0x00, 0x00, 0xFF} // type=server_name, declared len 255
+	extsLen := len(ext)
+	body = append(body, byte(extsLen>>8), byte(extsLen))
+	body = append(body, ext...)
+
+	record := []byte{0x01, 0, 0, 0} // handshake type client_hello, len filled below
+	msgLen := len(body)
+	record[1] = byte(msgLen >> 16)
+	record[2] = byte(msgLen >> 8)
+	record[3] = byte(msgLen)
+	record = append(record, body...)
+
+	if _, err := parseClientHelloServerName(record); err == nil {
+		t.Fatal("expected an error for a server_name extension longer than the record, got nil")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// listenerConfig collects everything a ListenerOption can influence before
+// a socket is actually bound.
+type listenerConfig struct {
+	lc      net.ListenConfig
+	inherit bool
+}
+
+// ListenerOption configures low-level socket behavior for NewListener and
+// NewListenerTLS, mirroring the functional-options style used elsewhere in
+// the standard library (e.g. grpc.DialOption).
+type ListenerOption func(*listenerConfig)
+
+// WithReusePort sets SO_REUSEPORT on the listening socket so that more than
+// one process (for instance the old and new binary during GracefulRestart)
+// can bind the same address concurrently.
+func WithReusePort() ListenerOption {
+	return withControl(setReusePort)
+}
+
+// WithReuseAddr sets SO_REUSEADDR on the listening socket, allowing a new
+// listener to bind an address still in TIME_WAIT from a previous process.
+func WithReuseAddr() ListenerOption {
+	return withControl(setReuseAddr)
+}
+
+// WithFreeBind sets IP_FREEBIND on the listening socket, allowing it to
+// bind an address that isn't yet assigned to any local interface.
+func WithFreeBind() ListenerOption {
+	return withControl(setFreeBind)
+}
+
+// WithInheritedListener tells NewListener / NewListenerTLS to reuse the
+// listening socket passed down by a parent process via GracefulRestart
+// instead of binding a fresh one. If no inherited socket is found (the
+// process wasn't started as part of a graceful restart), the option is
+// ignored and a new socket is bound as usual.
+func WithInheritedListener() ListenerOption {
+	return func(cfg *listenerConfig) {
+		cfg.inherit = true
+	}
+}
+
+// newRawListener binds network/addr honoring cfg, preferring an inherited
+// socket from GracefulRestart over a fresh bind when WithInheritedListener
+// was requested and a parent actually handed one down.
+func newRawListener(cfg *listenerConfig, network, addr string) (net.Listener, error) {
+	if cfg.inherit {
+		l, ok, err := inheritedListener()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return l, nil
+		}
+	}
+
+	if network == "unix" || network == "unixpacket" {
+		return newUnixListener(cfg, network, addr)
+	}
+	return cfg.lc.Listen(context.Background(), network, addr)
+}
+
+// withControl returns a ListenerOption that chains fn into the
+// net.ListenConfig's Control callback alongside any Control set by a
+// previously applied option.
+func withControl(fn func(fd uintptr) error) ListenerOption {
+	return func(cfg *listenerConfig) {
+		prev := cfg.lc.Control
+		cfg.lc.Control = func(network, address string, c syscall.RawConn) error {
+			if prev != nil {
+				if err := prev(network, address, c); err != nil {
+					return err
+				}
+			}
+			var ctrlErr error
+			if err := c.Control(func(fd uintptr) {
+				ctrlErr = fn(fd)
+			}); err != nil {
+				return err
+			}
+			return ctrlErr
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package httptimeout
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SO_REUSEPORT and IP_FREEBIND aren't exposed by the standard syscall
+// package on every architecture (SO_REUSEPORT, for instance, is missing
+// for linux/amd64). golang.org/x/sys/unix generates these constants per
+// architecture from the real kernel headers, so use it instead of
+// hard-coding values that are only correct on some of them.
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+}
+
+func setReuseAddr(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+}
+
+func setFreeBind(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_FREEBIND, 1)
+}
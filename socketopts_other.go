@@ -0,0 +1,37 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package httptimeout
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errSocketOptionUnsupported = errors.New("httptimeout: socket option is not supported on this platform")
+
+func setReusePort(fd uintptr) error {
+	return errSocketOptionUnsupported
+}
+
+func setReuseAddr(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+}
+
+func setFreeBind(fd uintptr) error {
+	return errSocketOptionUnsupported
+}
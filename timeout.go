@@ -1,123 +0,0 @@
-// Copyright 2016 Burak Sezer
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-
-//     http://www.apache.org/licenses/LICENSE-2.0
-
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package timeout
-
-import (
-	"crypto/tls"
-	"net"
-	"net/http"
-	"time"
-)
-
-// Conn wraps a net.Conn, and sets a deadline for every read
-// and write operation.
-type Conn struct {
-	net.Conn
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-}
-
-func (c *Conn) Read(b []byte) (int, error) {
-	err := c.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
-	if err != nil {
-		return 0, err
-	}
-	return c.Conn.Read(b)
-}
-
-func (c *Conn) Write(b []byte) (int, error) {
-	err := c.Conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
-	if err != nil {
-		return 0, err
-	}
-	return c.Conn.Write(b)
-}
-
-func NewTransport(addr string, timeout time.Duration) *http.Transport {
-	t := &http.Transport{}
-	t.Dial = func(network, addr string) (net.Conn, error) {
-		conn, err := net.DialTimeout(network, addr, timeout)
-		if err != nil {
-			return nil, err
-		}
-		tc := &Conn{
-			Conn:         conn,
-			ReadTimeout:  timeout,
-			WriteTimeout: timeout,
-		}
-		return tc, nil
-	}
-	return t
-}
-
-// Listener wraps a net.Listener, and gives a place to store the timeout
-// parameters. On Accept, it will wrap the net.Conn with our own Conn for us.
-type Listener struct {
-	net.Listener
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-}
-
-func (l *Listener) Accept() (net.Conn, error) {
-	c, err := l.Listener.Accept()
-	if err != nil {
-		return nil, err
-	}
-	tc := &Conn{
-		Conn:         c,
-		ReadTimeout:  l.ReadTimeout,
-		WriteTimeout: l.WriteTimeout,
-	}
-	return tc, nil
-}
-
-func NewListener(addr string, readTimeout, writeTimeout time.Duration) (net.Listener, error) {
-	conn, err := net.Listen("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
-
-	tl := &Listener{
-		Listener:     conn,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-	}
-	return tl, nil
-}
-
-func NewListenerTLS(addr, certFile, keyFile string, readTimeout, writeTimeout time.Duration) (net.Listener, error) {
-	config := &tls.Config{}
-	if config.NextProtos == nil {
-		config.NextProtos = []string{"http/1.1"}
-	}
-
-	var err error
-	config.Certificates = make([]tls.Certificate, 1)
-	config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, err
-	}
-
-	conn, err := net.Listen("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
-	tl := &Listener{
-		Listener:     tls.NewListener(conn, config),
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-	}
-	return tl, nil
-}
@@ -0,0 +1,84 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// errNoCertificateSource is returned by tlsConfig when neither a
+// certificate nor a GetCertificate callback was supplied by any of
+// TLSOptions.Config, CertFile/KeyFile or GetCertificate, which would
+// otherwise produce a *tls.Config that fails every handshake at runtime.
+var errNoCertificateSource = errors.New("httptimeout: TLSOptions has no certificate: set CertFile/KeyFile, GetCertificate, or Config.Certificates/GetCertificate")
+
+// TLSOptions configures the TLS behavior of NewListenerTLS.
+type TLSOptions struct {
+	// Config, if set, is used as the base TLS configuration and cloned
+	// before NewListenerTLS fills in NextProtos/Certificates/GetCertificate.
+	// Leave it nil to start from an empty *tls.Config.
+	Config *tls.Config
+
+	// CertFile and KeyFile load a certificate pair via
+	// tls.LoadX509KeyPair. Ignored when GetCertificate is set.
+	CertFile string
+	KeyFile  string
+
+	// GetCertificate, when set, takes precedence over CertFile/KeyFile and
+	// is wired directly into tls.Config.GetCertificate. This is how an
+	// autocert.Manager plugs in on-demand ACME certificates; see
+	// NewAutocertListener.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// HTTP2 advertises "h2" via ALPN ahead of "http/1.1" when Config (or
+	// its clone) doesn't already set NextProtos. Defaults to false, which
+	// preserves NewListenerTLS's original http/1.1-only behavior.
+	HTTP2 bool
+}
+
+// tlsConfig builds the *tls.Config NewListenerTLS hands to tls.NewListener.
+func (o TLSOptions) tlsConfig() (*tls.Config, error) {
+	var config *tls.Config
+	if o.Config != nil {
+		config = o.Config.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if len(config.NextProtos) == 0 {
+		if o.HTTP2 {
+			config.NextProtos = []string{"h2", "http/1.1"}
+		} else {
+			config.NextProtos = []string{"http/1.1"}
+		}
+	}
+
+	switch {
+	case o.GetCertificate != nil:
+		config.GetCertificate = o.GetCertificate
+	case o.CertFile != "" || o.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.GetCertificate == nil && len(config.Certificates) == 0 {
+		return nil, errNoCertificateSource
+	}
+	return config, nil
+}
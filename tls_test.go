@@ -0,0 +1,38 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSOptionsRequiresCertificateSource(t *testing.T) {
+	if _, err := (TLSOptions{}).tlsConfig(); err == nil {
+		t.Fatal("tlsConfig succeeded with no certificate source, want an error")
+	}
+
+	opts := TLSOptions{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return nil, nil
+	}}
+	if _, err := opts.tlsConfig(); err != nil {
+		t.Fatalf("tlsConfig with GetCertificate: %v", err)
+	}
+
+	opts = TLSOptions{Config: &tls.Config{Certificates: []tls.Certificate{{}}}}
+	if _, err := opts.tlsConfig(); err != nil {
+		t.Fatalf("tlsConfig with Config.Certificates: %v", err)
+	}
+}
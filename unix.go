@@ -0,0 +1,77 @@
+// Copyright 2016 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptimeout
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+)
+
+// unixSocketPerm is the file mode applied to freshly created Unix domain
+// sockets so that only the owner and group can connect to them.
+const unixSocketPerm = 0660
+
+// NewUnixListener binds a Unix domain socket at addr, removing a stale
+// socket file left behind by a previous, uncleanly terminated process
+// before binding. network must be "unix" or "unixpacket".
+func NewUnixListener(network, addr string) (net.Listener, error) {
+	return newUnixListener(&listenerConfig{}, network, addr)
+}
+
+// newUnixListener is the shared implementation behind NewUnixListener and
+// the unix:// handling in NewListener/NewListenerTLS, so that socket
+// options passed via ListenerOption also apply to Unix domain sockets.
+func newUnixListener(cfg *listenerConfig, network, addr string) (net.Listener, error) {
+	if network != "unix" && network != "unixpacket" {
+		return nil, errors.New("httptimeout: network must be \"unix\" or \"unixpacket\"")
+	}
+
+	if err := removeStaleSocket(addr); err != nil {
+		return nil, err
+	}
+
+	l, err := cfg.lc.Listen(context.Background(), network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(addr, unixSocketPerm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes addr if it exists and nothing is actually
+// listening on it anymore. A live socket is left untouched so two
+// processes can't steal each other's listener.
+func removeStaleSocket(addr string) error {
+	_, err := os.Stat(addr)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	conn, err := net.Dial("unix", addr)
+	if err == nil {
+		conn.Close()
+		return errors.New("httptimeout: socket " + addr + " is already in use")
+	}
+	return os.Remove(addr)
+}